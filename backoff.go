@@ -0,0 +1,22 @@
+package cluster
+
+import (
+	"math/rand"
+	"time"
+)
+
+// nextBackoff doubles cur for the next attempt, capped at max.
+func nextBackoff(cur, max time.Duration) time.Duration {
+	next := cur * 2
+	if next <= 0 || next > max {
+		next = max
+	}
+	return next
+}
+
+// jitter returns d adjusted by up to ±20%, so that retrying members
+// don't all wake up and hammer ZooKeeper/Kafka at the same instant.
+func jitter(d time.Duration) time.Duration {
+	delta := float64(d) * 0.2
+	return d + time.Duration((rand.Float64()*2-1)*delta)
+}
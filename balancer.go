@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+)
+
+// assignment maps a topic to the partitions assigned to a single group
+// member for one rebalance cycle.
+type assignment map[string][]int32
+
+// balance computes the partition assignment for every member of the
+// group according to the given strategy. members maps each member ID
+// to the topics it subscribes to; partitions maps each topic to its
+// full set of partition IDs.
+func balance(strategy Strategy, members map[string][]string, partitions map[string][]int32) (map[string]assignment, error) {
+	switch strategy {
+	case StrategyCopartitioned:
+		return balanceCopartitioned(members, partitions)
+	default:
+		return balanceRange(members, partitions)
+	}
+}
+
+// subscribers inverts members into topic -> sorted member list, so each
+// topic's partitions can be distributed deterministically.
+func subscribers(members map[string][]string) map[string][]string {
+	subs := make(map[string][]string)
+	for member, topics := range members {
+		for _, topic := range topics {
+			subs[topic] = append(subs[topic], member)
+		}
+	}
+	for _, subscribers := range subs {
+		sort.Strings(subscribers)
+	}
+	return subs
+}
+
+// balanceRange distributes each topic's partitions independently across
+// the members subscribing to it, round-robin by partition index.
+func balanceRange(members map[string][]string, partitions map[string][]int32) (map[string]assignment, error) {
+	result := make(map[string]assignment, len(members))
+	for member := range members {
+		result[member] = make(assignment)
+	}
+
+	for topic, subs := range subscribers(members) {
+		if len(subs) == 0 {
+			continue
+		}
+		for i, pid := range partitions[topic] {
+			member := subs[i%len(subs)]
+			result[member][topic] = append(result[member][topic], pid)
+		}
+	}
+	return result, nil
+}
+
+// balanceCopartitioned assigns partition N of every subscribed topic to
+// the same group member. It requires every subscribed topic to have an
+// equal partition count and to be subscribed by the same set of
+// members; otherwise copartitioning cannot be guaranteed and an error
+// is returned so the caller can abort the rebalance.
+func balanceCopartitioned(members map[string][]string, partitions map[string][]int32) (map[string]assignment, error) {
+	result := make(map[string]assignment, len(members))
+	for member := range members {
+		result[member] = make(assignment)
+	}
+
+	subs := subscribers(members)
+	if len(subs) == 0 {
+		return result, nil
+	}
+
+	var refTopic string
+	var refSubs []string
+	for topic, topicSubs := range subs {
+		if refTopic == "" {
+			refTopic, refSubs = topic, topicSubs
+			continue
+		}
+		if len(topicSubs) != len(refSubs) {
+			return nil, fmt.Errorf("cluster: cannot copartition %q (%d subscribers) with %q (%d subscribers)",
+				topic, len(topicSubs), refTopic, len(refSubs))
+		}
+		for i := range topicSubs {
+			if topicSubs[i] != refSubs[i] {
+				return nil, fmt.Errorf("cluster: cannot copartition %q and %q, they are not subscribed by the same members", topic, refTopic)
+			}
+		}
+	}
+
+	refCount := len(partitions[refTopic])
+	for topic := range subs {
+		if n := len(partitions[topic]); n != refCount {
+			return nil, fmt.Errorf("cluster: cannot copartition %q (%d partitions) with %q (%d partitions), partition counts must match",
+				topic, n, refTopic, refCount)
+		}
+	}
+
+	n := len(refSubs)
+	for topic := range subs {
+		for _, pid := range partitions[topic] {
+			member := refSubs[int(pid)%n]
+			result[member][topic] = append(result[member][topic], pid)
+		}
+	}
+	return result, nil
+}
@@ -95,8 +95,12 @@ var _ = BeforeSuite(func() {
 		return err
 	}, "10s", "1s").ShouldNot(HaveOccurred())
 
-	// Create a special truncated topic B with 6 topics
-	cmd := exec.Command(cli, "--zookeeper", "localhost:22181", "--create", "--topic", tTopicB, "--partitions", "6", "--replication-factor", "1")
+	// Create topics A and B, both with 6 partitions so copartitioning
+	// assigners can be exercised
+	cmd := exec.Command(cli, "--zookeeper", "localhost:22181", "--create", "--topic", tTopicA, "--partitions", "6", "--replication-factor", "1")
+	Expect(cmd.Run()).NotTo(HaveOccurred())
+
+	cmd = exec.Command(cli, "--zookeeper", "localhost:22181", "--create", "--topic", tTopicB, "--partitions", "6", "--replication-factor", "1")
 	Expect(cmd.Run()).NotTo(HaveOccurred())
 
 	// Create a special truncated topic X with a small retention config
@@ -133,6 +137,9 @@ var _ = BeforeSuite(func() {
 })
 
 var _ = AfterSuite(func() {
+	scenario.mu.Lock()
+	defer scenario.mu.Unlock()
+
 	if scenario.kafka != nil {
 		scenario.kafka.Process.Kill()
 	}
@@ -156,7 +163,13 @@ func TestSuite(t *testing.T) {
 
 // --------------------------------------------------------------------
 
-var scenario struct{ kafka, zk *exec.Cmd }
+// mu guards kafka/zk below, since a spec that intentionally disrupts
+// ZooKeeper (see rebalance_retry_test.go) replaces scenario.zk with a
+// freshly restarted process for the rest of the suite to use.
+var scenario struct {
+	mu        sync.Mutex
+	kafka, zk *exec.Cmd
+}
 
 func newConsumer(topics []string, conf *Config) (*Consumer, error) {
 	if topics == nil {
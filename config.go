@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Strategy determines how a rebalance assigns partitions to the
+// members of a consumer group.
+type Strategy string
+
+const (
+	// StrategyRange assigns each subscribed topic's partitions
+	// independently across the members that subscribe to it, dealing
+	// them out round-robin by partition index rather than in contiguous
+	// ranges. This is the default.
+	StrategyRange Strategy = "range"
+
+	// StrategyCopartitioned assigns partition N of every subscribed
+	// topic to the same group member. Stream-processing consumers that
+	// join or look up state across topics produced with the same keys
+	// require this to guarantee copartitioning. All topics passed to
+	// NewConsumer must have an equal number of partitions, or the
+	// rebalance fails.
+	StrategyCopartitioned Strategy = "copartitioned"
+)
+
+// Config extends sarama.Config with consumer group specific settings.
+type Config struct {
+	// Client is the underlying sarama client configuration.
+	Client *sarama.Config
+
+	// ZooKeeper holds settings for the ZooKeeper connection used for
+	// group membership and offset storage.
+	ZooKeeper struct {
+		// Timeout is the ZooKeeper session timeout. Defaults to 1s.
+		Timeout time.Duration
+	}
+
+	// Strategy determines how partitions are distributed across group
+	// members on rebalance. Defaults to StrategyRange.
+	Strategy Strategy
+
+	// Notifier, if set, is notified of rebalance and commit lifecycle
+	// events starting with the initial join performed by NewConsumer.
+	Notifier Notifier
+
+	// Consumer holds settings for the per-partition sarama consumers
+	// created for claimed partitions.
+	Consumer struct {
+		Return struct {
+			// Errors, if true, causes consumption errors from the
+			// underlying sarama.PartitionConsumer of every claimed
+			// partition to be surfaced on Consumer.Errors(). Mirrors
+			// sarama.Config.Consumer.Return.Errors. Defaults to false.
+			Errors bool
+		}
+	}
+
+	// Group holds settings that apply to the consumer group as a whole,
+	// as opposed to this particular member.
+	Group struct {
+		Rebalance struct {
+			Retry struct {
+				// Max is the number of times a rebalance is retried
+				// before it is given up on and surfaced via
+				// Notifier.RebalanceError. Also applies to
+				// re-registering after a ZooKeeper session expires.
+				// Defaults to 4.
+				Max int
+
+				// Backoff is the initial delay before the first retry.
+				// It grows exponentially (doubling per attempt, capped
+				// at BackoffMax) with up to ±20% jitter applied.
+				// Defaults to 250ms.
+				Backoff time.Duration
+
+				// BackoffMax caps the exponentially growing backoff.
+				// Defaults to 2s.
+				BackoffMax time.Duration
+			}
+		}
+
+		Offsets struct {
+			// CheckInterval is the polling interval Consumer.WaitForOffsets
+			// uses while waiting for committed offsets to catch up to the
+			// high water mark. Defaults to 500ms.
+			CheckInterval time.Duration
+
+			// AutoCommit holds settings for flushing offsets marked via
+			// Consumer.MarkOffset to ZooKeeper, mirroring
+			// sarama.Config.Consumer.Offsets.AutoCommit.
+			AutoCommit struct {
+				// Interval is how often marked offsets are committed.
+				// Defaults to 1s.
+				Interval time.Duration
+			}
+		}
+	}
+}
+
+// NewConfig returns a new configuration instance with sane defaults.
+func NewConfig() *Config {
+	c := &Config{}
+	c.Client = sarama.NewConfig()
+	c.ZooKeeper.Timeout = 1 * time.Second
+	c.Strategy = StrategyRange
+	c.Group.Rebalance.Retry.Max = 4
+	c.Group.Rebalance.Retry.Backoff = 250 * time.Millisecond
+	c.Group.Rebalance.Retry.BackoffMax = 2 * time.Second
+	c.Group.Offsets.CheckInterval = 500 * time.Millisecond
+	c.Group.Offsets.AutoCommit.Interval = 1 * time.Second
+	return c
+}
+
+// Validate checks a Config instance for sane values and returns a
+// descriptive error if a setting is invalid.
+func (c *Config) Validate() error {
+	if err := c.Client.Validate(); err != nil {
+		return err
+	}
+	if c.ZooKeeper.Timeout <= 0 {
+		return sarama.ConfigurationError("ZooKeeper.Timeout should have a duration > 0")
+	}
+	switch c.Strategy {
+	case StrategyRange, StrategyCopartitioned:
+	default:
+		return sarama.ConfigurationError("Strategy should be one of StrategyRange or StrategyCopartitioned")
+	}
+	if c.Group.Rebalance.Retry.Max < 0 {
+		return sarama.ConfigurationError("Group.Rebalance.Retry.Max should be >= 0")
+	}
+	if c.Group.Rebalance.Retry.Backoff <= 0 {
+		return sarama.ConfigurationError("Group.Rebalance.Retry.Backoff should have a duration > 0")
+	}
+	if c.Group.Rebalance.Retry.BackoffMax < c.Group.Rebalance.Retry.Backoff {
+		return sarama.ConfigurationError("Group.Rebalance.Retry.BackoffMax should be >= Group.Rebalance.Retry.Backoff")
+	}
+	if c.Group.Offsets.CheckInterval <= 0 {
+		return sarama.ConfigurationError("Group.Offsets.CheckInterval should have a duration > 0")
+	}
+	if c.Group.Offsets.AutoCommit.Interval <= 0 {
+		return sarama.ConfigurationError("Group.Offsets.AutoCommit.Interval should have a duration > 0")
+	}
+	return nil
+}
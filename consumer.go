@@ -0,0 +1,622 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Consumer is a ZooKeeper-coordinated consumer group. It claims
+// partitions of one or more topics across its peers and exposes a
+// single merged stream of sarama.ConsumerMessage.
+type Consumer struct {
+	client    sarama.Client
+	pconsumer sarama.Consumer
+	zk        *ZK
+	config    *Config
+
+	group  string
+	topics []string
+	id     string
+
+	notifier Notifier
+	notifyMu sync.Mutex
+
+	messages      chan *sarama.ConsumerMessage
+	errors        chan *sarama.ConsumerError
+	notifications chan *Notification
+
+	consumersMu sync.Mutex
+	consumers   map[string]map[int32]sarama.PartitionConsumer
+	claimed     assignment
+
+	marksMu sync.Mutex
+	marks   map[string]map[int32]int64
+
+	rebalanceMu sync.Mutex
+
+	membersMu sync.Mutex
+	membersCh <-chan zk.Event
+
+	fanIn     sync.WaitGroup
+	dying     chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConsumer joins group, subscribing to topics, and blocks until an
+// initial rebalance assigns this member its partitions.
+func NewConsumer(addrs, zkAddrs []string, group string, topics []string, config *Config) (*Consumer, error) {
+	if config == nil {
+		config = NewConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(addrs, config.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	zkConn, err := NewZK(zkAddrs, config.ZooKeeper.Timeout)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	pconsumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		zkConn.Close()
+		client.Close()
+		return nil, err
+	}
+
+	c := &Consumer{
+		client:        client,
+		pconsumer:     pconsumer,
+		zk:            zkConn,
+		config:        config,
+		group:         group,
+		topics:        topics,
+		id:            fmt.Sprintf("%s:%d", mustHostname(), os.Getpid()),
+		messages:      make(chan *sarama.ConsumerMessage),
+		notifications: make(chan *Notification, 16),
+		consumers:     make(map[string]map[int32]sarama.PartitionConsumer),
+		marks:         make(map[string]map[int32]int64),
+		notifier:      config.Notifier,
+		dying:         make(chan struct{}),
+	}
+	if config.Consumer.Return.Errors {
+		// sarama only delivers partition consumer errors on Errors() when
+		// its own Return.Errors is set; the client shares this config.
+		config.Client.Consumer.Return.Errors = true
+		c.errors = make(chan *sarama.ConsumerError)
+	}
+
+	if err := c.zk.RegisterGroup(group); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.zk.RegisterConsumer(group, c.id, topics); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if err := c.rebalanceWithRetry(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	go c.watchSession()
+	go c.watchMembership()
+	go c.autoCommit()
+
+	return c, nil
+}
+
+// Notify installs n as the observer of this consumer's rebalance and
+// commit lifecycle. It replaces any previously installed notifier.
+func (c *Consumer) Notify(n Notifier) {
+	c.notifyMu.Lock()
+	c.notifier = n
+	c.notifyMu.Unlock()
+}
+
+func (c *Consumer) currentNotifier() Notifier {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	return c.notifier
+}
+
+// Messages returns the merged stream of messages from every partition
+// currently claimed by this consumer.
+func (c *Consumer) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// Errors returns the merged stream of consumption errors from every
+// partition currently claimed by this consumer, tagged with the
+// originating topic/partition by sarama.ConsumerError. It is only
+// populated when Config.Consumer.Return.Errors is true; otherwise it is
+// nil, mirroring sarama.Consumer.Errors().
+func (c *Consumer) Errors() <-chan *sarama.ConsumerError {
+	return c.errors
+}
+
+// Notifications returns a stream of rebalance events, mirroring the
+// callbacks delivered to an installed Notifier. The channel is
+// buffered; a notification is dropped rather than blocking rebalance if
+// the caller isn't keeping up.
+func (c *Consumer) Notifications() <-chan *Notification {
+	return c.notifications
+}
+
+func (c *Consumer) notify(typ NotificationType) {
+	var current map[string][]int32
+	if typ == RebalanceOK {
+		current = make(map[string][]int32, len(c.claimed))
+		for topic, pids := range c.claimed {
+			current[topic] = pids
+		}
+	}
+	select {
+	case c.notifications <- &Notification{Type: typ, Current: current}:
+	default:
+	}
+}
+
+// Close leaves the group, releases all claimed partitions and closes
+// the underlying sarama and ZooKeeper connections.
+func (c *Consumer) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.dying)
+
+		c.consumersMu.Lock()
+		for topic, byPartition := range c.consumers {
+			for partition, pc := range byPartition {
+				pc.AsyncClose()
+				delete(byPartition, partition)
+			}
+			delete(c.consumers, topic)
+		}
+		c.consumersMu.Unlock()
+
+		c.fanIn.Wait()
+		close(c.messages)
+		close(c.notifications)
+		if c.errors != nil {
+			close(c.errors)
+		}
+
+		if c.pconsumer != nil {
+			c.pconsumer.Close()
+		}
+		if c.zk != nil {
+			c.zk.Close()
+		}
+		if c.client != nil {
+			err = c.client.Close()
+		}
+	})
+	return err
+}
+
+// CommitUpto persists the offset of msg (plus one) to ZooKeeper as the
+// last processed offset for its topic/partition. On failure, it notifies
+// Notifier.CommitError in addition to returning the error.
+func (c *Consumer) CommitUpto(msg *sarama.ConsumerMessage) error {
+	err := c.zk.CommitOffset(c.group, msg.Topic, msg.Partition, msg.Offset+1)
+	if err != nil {
+		if n := c.currentNotifier(); n != nil {
+			n.CommitError(c, err)
+		}
+		return err
+	}
+
+	// Drop any mark buffered by MarkOffset for this topic/partition, so
+	// the next automatic commit tick doesn't clobber this (newer or
+	// equal) commit with a stale one.
+	c.marksMu.Lock()
+	delete(c.marks[msg.Topic], msg.Partition)
+	c.marksMu.Unlock()
+
+	return nil
+}
+
+// MarkOffset marks msg as processed, buffering its offset (plus one) to
+// be committed to ZooKeeper on the next automatic commit tick (see
+// Config.Group.Offsets.AutoCommit.Interval). A successful CommitUpto for
+// the same topic/partition before that tick discards the buffered mark
+// and commits its own message's offset instead. metadata is
+// currently unused, reserved for application-defined commit annotations.
+func (c *Consumer) MarkOffset(msg *sarama.ConsumerMessage, metadata string) {
+	c.marksMu.Lock()
+	defer c.marksMu.Unlock()
+
+	byPartition, ok := c.marks[msg.Topic]
+	if !ok {
+		byPartition = make(map[int32]int64)
+		c.marks[msg.Topic] = byPartition
+	}
+	byPartition[msg.Partition] = msg.Offset + 1
+}
+
+// autoCommit periodically flushes offsets buffered by MarkOffset to
+// ZooKeeper, until the consumer is closed.
+func (c *Consumer) autoCommit() {
+	ticker := time.NewTicker(c.config.Group.Offsets.AutoCommit.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.dying:
+			return
+		case <-ticker.C:
+			c.flushMarks()
+		}
+	}
+}
+
+// flushMarks commits every offset buffered by MarkOffset to ZooKeeper
+// and clears the buffer, notifying Notifier.CommitError for any
+// individual commit that fails rather than aborting the flush.
+func (c *Consumer) flushMarks() {
+	c.marksMu.Lock()
+	marks := c.marks
+	c.marks = make(map[string]map[int32]int64, len(marks))
+	c.marksMu.Unlock()
+
+	for topic, byPartition := range marks {
+		for partition, offset := range byPartition {
+			if err := c.zk.CommitOffset(c.group, topic, partition, offset); err != nil {
+				if n := c.currentNotifier(); n != nil {
+					n.CommitError(c, err)
+				}
+			}
+		}
+	}
+}
+
+// HighWaterMarks returns the broker-reported high water mark offset for
+// every partition currently claimed by this consumer, keyed by topic.
+func (c *Consumer) HighWaterMarks() map[string]map[int32]int64 {
+	c.consumersMu.Lock()
+	defer c.consumersMu.Unlock()
+
+	hwms := make(map[string]map[int32]int64, len(c.consumers))
+	for topic, byPartition := range c.consumers {
+		marks := make(map[int32]int64, len(byPartition))
+		for partition, pc := range byPartition {
+			marks[partition] = pc.HighWaterMarkOffset()
+		}
+		hwms[topic] = marks
+	}
+	return hwms
+}
+
+// WaitForOffsets blocks until the committed offset in ZooKeeper for
+// every partition of topics that this consumer currently owns is at
+// least as high as the high water mark observed at call time, or until
+// ctx is done. It lets operators drain a group before a controlled
+// shutdown, or tests assert that everything produced so far has been
+// consumed and committed.
+func (c *Consumer) WaitForOffsets(ctx context.Context, topics []string) error {
+	wanted := make(map[string]map[int32]int64, len(topics))
+	for topic, marks := range c.HighWaterMarks() {
+		for _, t := range topics {
+			if t == topic {
+				wanted[topic] = marks
+				break
+			}
+		}
+	}
+
+	interval := c.config.Group.Offsets.CheckInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ready := true
+		for topic, marks := range wanted {
+			for partition, hwm := range marks {
+				committed, err := c.zk.Offset(c.group, topic, partition)
+				if err != nil {
+					return err
+				}
+				if committed < hwm {
+					ready = false
+				}
+			}
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// rebalanceWithRetry retries rebalance up to Config.Group.Rebalance.Retry.Max
+// times with exponential-with-jitter backoff, only surfacing the failure
+// via Notifier.RebalanceError (and RebalanceError on Notifications())
+// once every attempt has been exhausted.
+func (c *Consumer) rebalanceWithRetry() error {
+	c.rebalanceMu.Lock()
+	defer c.rebalanceMu.Unlock()
+
+	backoff := c.config.Group.Rebalance.Retry.Backoff
+	backoffMax := c.config.Group.Rebalance.Retry.BackoffMax
+
+	var lastErr error
+	for attempt := 0; attempt <= c.config.Group.Rebalance.Retry.Max; attempt++ {
+		if attempt > 0 {
+			time.Sleep(jitter(backoff))
+			backoff = nextBackoff(backoff, backoffMax)
+		}
+
+		if n := c.currentNotifier(); n != nil {
+			n.RebalanceStart(c)
+		}
+		c.notify(RebalanceStart)
+
+		if err := c.rebalance(); err != nil {
+			lastErr = err
+			continue
+		}
+
+		if n := c.currentNotifier(); n != nil {
+			n.RebalanceOK(c)
+		}
+		c.notify(RebalanceOK)
+		return nil
+	}
+
+	if n := c.currentNotifier(); n != nil {
+		n.RebalanceError(c, lastErr)
+	}
+	c.notify(RebalanceError)
+	return lastErr
+}
+
+// rebalance recomputes the partition assignment for the whole group and
+// claims this member's share. If the strategy cannot produce a valid
+// assignment (for example, StrategyCopartitioned over topics with
+// mismatched partition counts), the error is returned so the caller can
+// retry or give up.
+func (c *Consumer) rebalance() error {
+	partitions := make(map[string][]int32, len(c.topics))
+	for _, topic := range c.topics {
+		pids, err := c.client.Partitions(topic)
+		if err != nil {
+			return err
+		}
+		partitions[topic] = pids
+	}
+
+	members, membersCh, err := c.zk.MembersW(c.group)
+	if err != nil {
+		return err
+	}
+	c.membersMu.Lock()
+	c.membersCh = membersCh
+	c.membersMu.Unlock()
+
+	assignments, err := balance(c.config.Strategy, members, partitions)
+	if err != nil {
+		return err
+	}
+
+	mine := assignments[c.id]
+	if err := c.releaseUnassigned(mine); err != nil {
+		return err
+	}
+
+	for topic, pids := range mine {
+		for _, pid := range pids {
+			if err := c.zk.Claim(c.group, topic, pid, c.id); err != nil {
+				return err
+			}
+			if err := c.consumePartition(topic, pid); err != nil {
+				return err
+			}
+		}
+	}
+	c.claimed = mine
+
+	return nil
+}
+
+// releaseUnassigned closes and unclaims any partition this member
+// currently has a running sarama.PartitionConsumer for, but that mine
+// (the assignment just computed by rebalance) no longer grants it. This
+// keeps a member that lost a partition to a peer from continuing to
+// consume and commit it alongside the new owner.
+func (c *Consumer) releaseUnassigned(mine assignment) error {
+	c.consumersMu.Lock()
+	defer c.consumersMu.Unlock()
+
+	for topic, byPartition := range c.consumers {
+		for partition, pc := range byPartition {
+			if containsPartition(mine[topic], partition) {
+				continue
+			}
+			pc.AsyncClose()
+			delete(byPartition, partition)
+			if err := c.zk.Unclaim(c.group, topic, partition); err != nil {
+				return err
+			}
+		}
+		if len(byPartition) == 0 {
+			delete(c.consumers, topic)
+		}
+	}
+	return nil
+}
+
+func containsPartition(pids []int32, partition int32) bool {
+	for _, pid := range pids {
+		if pid == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// consumePartition claims a sarama.PartitionConsumer for topic/partition
+// and fans its Messages (and, if enabled, Errors) into the aggregate
+// channels returned by Messages() and Errors(). It resumes from the
+// offset last committed to ZooKeeper for topic/partition, falling back
+// to Config.Client.Consumer.Offsets.Initial only if nothing has been
+// committed yet.
+func (c *Consumer) consumePartition(topic string, partition int32) error {
+	c.consumersMu.Lock()
+	defer c.consumersMu.Unlock()
+	if byPartition, ok := c.consumers[topic]; ok {
+		if _, ok := byPartition[partition]; ok {
+			return nil
+		}
+	}
+
+	offset, err := c.zk.Offset(c.group, topic, partition)
+	if err != nil {
+		return err
+	}
+	if offset == 0 {
+		offset = c.config.Client.Consumer.Offsets.Initial
+	}
+	pc, err := c.pconsumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		return err
+	}
+	if c.consumers[topic] == nil {
+		c.consumers[topic] = make(map[int32]sarama.PartitionConsumer)
+	}
+	c.consumers[topic][partition] = pc
+
+	c.fanIn.Add(1)
+	go func() {
+		defer c.fanIn.Done()
+		for msg := range pc.Messages() {
+			c.messages <- msg
+		}
+	}()
+
+	if c.errors != nil {
+		c.fanIn.Add(1)
+		go func() {
+			defer c.fanIn.Done()
+			for err := range pc.Errors() {
+				c.errors <- err
+			}
+		}()
+	}
+
+	return nil
+}
+
+// watchSession watches the ZooKeeper session for expiration and, on
+// expiry, reestablishes the connection and re-registers this member
+// before triggering a rebalance, all under the same retry/backoff
+// schedule as rebalanceWithRetry.
+func (c *Consumer) watchSession() {
+	for {
+		select {
+		case <-c.dying:
+			return
+		case ev, ok := <-c.zk.SessionEvents():
+			if !ok {
+				return
+			}
+			if ev.State != zk.StateExpired {
+				continue
+			}
+			if err := c.reestablishSession(); err != nil {
+				if n := c.currentNotifier(); n != nil {
+					n.RebalanceError(c, err)
+				}
+				c.notify(RebalanceError)
+			}
+		}
+	}
+}
+
+// watchMembership watches the consumer group's membership node and
+// triggers a rebalance on every running member whenever the member set
+// changes (a peer joins or leaves), not just on the peer that caused the
+// change. Without this, an already-running member never learns that a
+// partition it holds was reassigned to a new peer.
+func (c *Consumer) watchMembership() {
+	for {
+		c.membersMu.Lock()
+		ch := c.membersCh
+		c.membersMu.Unlock()
+		if ch == nil {
+			return
+		}
+
+		select {
+		case <-c.dying:
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := c.rebalanceWithRetry(); err != nil {
+				if n := c.currentNotifier(); n != nil {
+					n.RebalanceError(c, err)
+				}
+				c.notify(RebalanceError)
+			}
+		}
+	}
+}
+
+// reestablishSession reconnects to ZooKeeper and re-registers this
+// member, retrying with the same exponential-with-jitter backoff used
+// for rebalances, and finishes with a rebalance once the session is
+// restored.
+func (c *Consumer) reestablishSession() error {
+	backoff := c.config.Group.Rebalance.Retry.Backoff
+	backoffMax := c.config.Group.Rebalance.Retry.BackoffMax
+
+	var lastErr error
+	for attempt := 0; attempt <= c.config.Group.Rebalance.Retry.Max; attempt++ {
+		if attempt > 0 {
+			time.Sleep(jitter(backoff))
+			backoff = nextBackoff(backoff, backoffMax)
+		}
+
+		if err := c.zk.Reconnect(); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := c.zk.RegisterGroup(c.group); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := c.zk.RegisterConsumer(c.group, c.id, c.topics); err != nil {
+			lastErr = err
+			continue
+		}
+
+		return c.rebalanceWithRetry()
+	}
+	return lastErr
+}
+
+func mustHostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer, copartitioned", func() {
+
+	newCopartitionedConsumer := func() (*Consumer, error) {
+		conf := NewConfig()
+		conf.Strategy = StrategyCopartitioned
+		return newConsumer([]string{tTopicA, tTopicB}, conf)
+	}
+
+	// ownerOf returns, for every partition ID, the member owning that
+	// partition of topic according to ZooKeeper.
+	ownerOf := func(topic string, partitions int32) map[int32]string {
+		zk, err := NewZK(tZKAddrs, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		defer zk.Close()
+
+		owners := make(map[int32]string, partitions)
+		for pid := int32(0); pid < partitions; pid++ {
+			data, _, err := zk.conn.Get(fmt.Sprintf("/consumers/%s/owners/%s/%d", tGroup, topic, pid))
+			Expect(err).NotTo(HaveOccurred())
+			owners[pid] = string(data)
+		}
+		return owners
+	}
+
+	It("should assign partition N of every subscribed topic to the same member after every rebalance", func() {
+		c1, err := newCopartitionedConsumer()
+		Expect(err).NotTo(HaveOccurred())
+		defer c1.Close()
+
+		ownersA := ownerOf(tTopicA, 6)
+		ownersB := ownerOf(tTopicB, 6)
+		for pid := int32(0); pid < 6; pid++ {
+			Expect(ownersB[pid]).To(Equal(ownersA[pid]))
+		}
+
+		c2, err := newCopartitionedConsumer()
+		Expect(err).NotTo(HaveOccurred())
+		defer c2.Close()
+
+		ownersA = ownerOf(tTopicA, 6)
+		ownersB = ownerOf(tTopicB, 6)
+		for pid := int32(0); pid < 6; pid++ {
+			Expect(ownersB[pid]).To(Equal(ownersA[pid]))
+		}
+	})
+
+	It("should fail the join and notify RebalanceError when topic partition counts differ", func() {
+		conf := NewConfig()
+		conf.Strategy = StrategyCopartitioned
+		notifier := &mockNotifier{}
+		conf.Notifier = notifier
+
+		c, err := newConsumer([]string{tTopicA, tTopicX}, conf)
+		Expect(err).To(HaveOccurred())
+		if c != nil {
+			c.Close()
+		}
+		Expect(notifier.Messages()).To(ContainElement("REBALANCE ERROR"))
+	})
+
+})
@@ -0,0 +1,4 @@
+// Package cluster provides ZooKeeper-coordinated consumer groups for
+// Shopify/sarama, allowing multiple processes to share the partitions
+// of one or more topics.
+package cluster
@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer, Errors", func() {
+
+	It("should surface consumption errors tagged with topic/partition on the aggregate channel", func() {
+		conf := NewConfig()
+		conf.Consumer.Return.Errors = true
+
+		c, err := newConsumer([]string{tTopicX}, conf)
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+
+		c.consumersMu.Lock()
+		_, ok := c.consumers[tTopicX][0]
+		c.consumersMu.Unlock()
+		Expect(ok).To(BeTrue())
+
+		client, err := sarama.NewClient(tKafkaAddrs, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		producer, err := sarama.NewSyncProducerFromClient(client)
+		Expect(err).NotTo(HaveOccurred())
+		defer producer.Close()
+
+		// tTopicX was created in BeforeSuite with a tiny segment/retention
+		// config. Keep producing past it so the broker rolls and deletes
+		// the segment that the already-claimed partition consumer (checked
+		// above) is still reading from, forcing a broker-side
+		// ErrOffsetOutOfRange onto its Errors(), which fans into the
+		// aggregate channel under test rather than a second, disconnected
+		// consumer.
+		for i := 0; i < 10000; i++ {
+			kv := sarama.StringEncoder(fmt.Sprintf("TOPIC-X-FLOOD-%08d", i))
+			_, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: tTopicX, Key: kv, Value: kv})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var consumerErr *sarama.ConsumerError
+		Eventually(c.Errors(), "30s", "100ms").Should(Receive(&consumerErr))
+		Expect(consumerErr.Topic).To(Equal(tTopicX))
+	})
+
+})
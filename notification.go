@@ -0,0 +1,26 @@
+package cluster
+
+// NotificationType indicates the kind of rebalance event carried by a
+// Notification delivered on Consumer.Notifications().
+type NotificationType uint8
+
+const (
+	UnknownNotification NotificationType = iota
+	RebalanceStart
+	RebalanceOK
+	RebalanceError
+)
+
+// Notification carries the outcome of a single rebalance cycle. It is
+// delivered on Consumer.Notifications() alongside the equivalent
+// Notifier callback, for callers that prefer to select on a channel
+// rather than install an observer.
+type Notification struct {
+	// Type is the rebalance event this notification describes.
+	Type NotificationType
+
+	// Current is this member's partition assignment as of the end of
+	// the rebalance cycle. It is nil for RebalanceStart and
+	// RebalanceError notifications.
+	Current map[string][]int32
+}
@@ -0,0 +1,16 @@
+package cluster
+
+// Notifier is notified of rebalance and commit lifecycle events. It
+// lets callers observe consumer group health (logging, metrics) without
+// polling the consumer or ZooKeeper directly.
+type Notifier interface {
+	// RebalanceStart is called when a rebalance cycle starts.
+	RebalanceStart(*Consumer)
+	// RebalanceOK is called when a rebalance cycle completes successfully.
+	RebalanceOK(*Consumer)
+	// RebalanceError is called when a rebalance cycle fails after
+	// exhausting Config.Group.Rebalance.Retry.Max retries.
+	RebalanceError(*Consumer, error)
+	// CommitError is called when an offset commit to ZooKeeper fails.
+	CommitError(*Consumer, error)
+}
@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer, WaitForOffsets", func() {
+
+	It("should block until all seeded messages on tTopicA are consumed and committed", func() {
+		c, err := newConsumer([]string{tTopicA}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+
+		go func() {
+			for msg := range c.Messages() {
+				c.CommitUpto(msg)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		Expect(c.WaitForOffsets(ctx, []string{tTopicA})).NotTo(HaveOccurred())
+	})
+
+	It("should return the context error if offsets never catch up", func() {
+		c, err := newConsumer([]string{tTopicA}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		Expect(c.WaitForOffsets(ctx, []string{tTopicA})).To(Equal(context.DeadlineExceeded))
+	})
+
+})
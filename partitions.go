@@ -0,0 +1,21 @@
+package cluster
+
+// Partition describes a single partition as returned by a ZooKeeper
+// broker registration lookup.
+type Partition struct {
+	Addr string
+	ID   int32
+}
+
+// PartitionSlice attaches the methods of sort.Interface to []Partition,
+// ordering first by broker address and then by partition ID.
+type PartitionSlice []Partition
+
+func (s PartitionSlice) Len() int      { return len(s) }
+func (s PartitionSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s PartitionSlice) Less(i, j int) bool {
+	if s[i].Addr != s[j].Addr {
+		return s[i].Addr < s[j].Addr
+	}
+	return s[i].ID < s[j].ID
+}
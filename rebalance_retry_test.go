@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer, rebalance retry", func() {
+
+	It("should resume consuming after ZooKeeper is killed and restarted", func() {
+		run := testDir(tKafkaDir, "bin", "kafka-run-class.sh")
+
+		c, err := newConsumer([]string{tTopicA}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+
+		go func() {
+			for msg := range c.Messages() {
+				c.CommitUpto(msg)
+			}
+		}()
+
+		// Let the consumer make some initial progress before disrupting
+		// its ZooKeeper session, so the post-restart check below actually
+		// proves resumption rather than a first-time catch-up.
+		Eventually(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			return c.WaitForOffsets(ctx, []string{tTopicA})
+		}, "30s", "1s").Should(Succeed())
+
+		// Kill the ZK process started by BeforeSuite and restart it,
+		// simulating a transient session loss mid-consumption. scenario.mu
+		// protects the shared process handle, which AfterSuite also uses.
+		scenario.mu.Lock()
+		Expect(scenario.zk.Process.Kill()).NotTo(HaveOccurred())
+		scenario.zk.Wait()
+
+		scenario.zk = exec.Command(run, "-name", "zookeeper", "org.apache.zookeeper.server.ZooKeeperServerMain", testDir("zookeeper.properties"))
+		Expect(scenario.zk.Start()).NotTo(HaveOccurred())
+		scenario.mu.Unlock()
+
+		Eventually(func() bool {
+			_, err := NewZK(tZKAddrs, c.config.ZooKeeper.Timeout)
+			return err == nil
+		}, "30s", "1s").Should(BeTrue())
+
+		// Assert that consumption and committing actually resume, not
+		// just that some rebalance notification fired (which would also
+		// happen on a failed attempt).
+		Eventually(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			return c.WaitForOffsets(ctx, []string{tTopicA})
+		}, "30s", "1s").Should(Succeed())
+	})
+
+})
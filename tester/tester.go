@@ -0,0 +1,148 @@
+// Package tester provides an in-memory fake of *cluster.Consumer for
+// unit-testing code that depends on it, without booting a real
+// Kafka/ZooKeeper cluster.
+package tester
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	cluster "github.com/derekbassett/sarama-cluster"
+)
+
+// Consumer is an in-memory fake of *cluster.Consumer. It exposes the
+// same message/notification surface (Messages, Errors, Notifications,
+// CommitUpto, MarkOffset, Close) so it can stand in for the real
+// consumer behind an interface, plus a driver API (Emit, ExpectCommit,
+// SimulateRebalance) for tests to produce input and assert on output.
+type Consumer struct {
+	mu sync.Mutex
+
+	messages      chan *sarama.ConsumerMessage
+	errors        chan *sarama.ConsumerError
+	notifications chan *cluster.Notification
+
+	nextOffset map[string]map[int32]int64
+	committed  map[string]map[int32]int64
+
+	closeOnce sync.Once
+}
+
+// New returns an empty Consumer fake. Call SimulateRebalance to give it
+// a partition assignment before Emit-ing messages against it.
+func New() *Consumer {
+	return &Consumer{
+		messages:      make(chan *sarama.ConsumerMessage, 1024),
+		errors:        make(chan *sarama.ConsumerError, 16),
+		notifications: make(chan *cluster.Notification, 16),
+		nextOffset:    make(map[string]map[int32]int64),
+		committed:     make(map[string]map[int32]int64),
+	}
+}
+
+// Messages returns the stream of emitted messages, in Emit order per
+// topic/partition.
+func (c *Consumer) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// Errors returns the stream of injected consumption errors. Nothing is
+// ever sent on it unless a test does so directly.
+func (c *Consumer) Errors() <-chan *sarama.ConsumerError { return c.errors }
+
+// Notifications returns the stream of rebalance events delivered by
+// SimulateRebalance.
+func (c *Consumer) Notifications() <-chan *cluster.Notification { return c.notifications }
+
+// Close releases the fake's channels. It is idempotent.
+func (c *Consumer) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.messages)
+		close(c.errors)
+		close(c.notifications)
+	})
+	return nil
+}
+
+// Emit enqueues a message on topic/partition as if it had just been
+// produced and delivered by the broker, assigning it the next
+// sequential offset observed for that topic/partition.
+func (c *Consumer) Emit(topic string, partition int32, key, value []byte) {
+	c.mu.Lock()
+	byPartition, ok := c.nextOffset[topic]
+	if !ok {
+		byPartition = make(map[int32]int64)
+		c.nextOffset[topic] = byPartition
+	}
+	offset := byPartition[partition]
+	byPartition[partition] = offset + 1
+	c.mu.Unlock()
+
+	c.messages <- &sarama.ConsumerMessage{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+		Key:       key,
+		Value:     value,
+	}
+}
+
+// MarkOffset commits offset+1 for msg's topic/partition immediately.
+// Unlike *cluster.Consumer.MarkOffset, nothing is buffered until an
+// automatic commit tick.
+func (c *Consumer) MarkOffset(msg *sarama.ConsumerMessage, metadata string) {
+	c.commit(msg.Topic, msg.Partition, msg.Offset+1)
+}
+
+// CommitUpto commits offset+1 for msg's topic/partition, mirroring
+// *cluster.Consumer.CommitUpto.
+func (c *Consumer) CommitUpto(msg *sarama.ConsumerMessage) error {
+	c.commit(msg.Topic, msg.Partition, msg.Offset+1)
+	return nil
+}
+
+func (c *Consumer) commit(topic string, partition int32, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byPartition, ok := c.committed[topic]
+	if !ok {
+		byPartition = make(map[int32]int64)
+		c.committed[topic] = byPartition
+	}
+	byPartition[partition] = offset
+}
+
+// ExpectCommit blocks until offset has been committed for
+// topic/partition, or returns an error once a 1s poll deadline elapses,
+// so tests can assert on it with whichever framework they use.
+func (c *Consumer) ExpectCommit(topic string, partition int32, offset int64) error {
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		got, ok := c.committed[topic][partition]
+		c.mu.Unlock()
+		if ok && got == offset {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("tester: timed out waiting for %s/%d to commit offset %d, last committed %d", topic, partition, offset, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// SimulateRebalance delivers newAssignment on Notifications(), as if a
+// real rebalance cycle had just completed with this partition
+// assignment.
+func (c *Consumer) SimulateRebalance(newAssignment map[string][]int32) {
+	current := make(map[string][]int32, len(newAssignment))
+	for topic, pids := range newAssignment {
+		cp := make([]int32, len(pids))
+		copy(cp, pids)
+		current[topic] = cp
+	}
+	select {
+	case c.notifications <- &cluster.Notification{Type: cluster.RebalanceOK, Current: current}:
+	default:
+	}
+}
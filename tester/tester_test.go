@@ -0,0 +1,37 @@
+package tester
+
+import "testing"
+
+func TestConsumer(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	c.SimulateRebalance(map[string][]int32{
+		"topic-a": {0},
+		"topic-b": {0},
+	})
+
+	c.Emit("topic-a", 0, []byte("key-a"), []byte("value-a"))
+	c.Emit("topic-b", 0, []byte("key-b"), []byte("value-b"))
+
+	for i := 0; i < 2; i++ {
+		msg := <-c.Messages()
+		c.MarkOffset(msg, "")
+	}
+
+	if err := c.ExpectCommit("topic-a", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExpectCommit("topic-b", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case n := <-c.Notifications():
+		if len(n.Current) != 2 {
+			t.Fatalf("expected 2 topics in rebalance notification, got %d", len(n.Current))
+		}
+	default:
+		t.Fatal("expected a buffered rebalance notification")
+	}
+}
@@ -0,0 +1,242 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// ZK wraps a connection to a ZooKeeper ensemble and exposes the small
+// set of operations the consumer group needs to track membership,
+// partition ownership and committed offsets.
+type ZK struct {
+	mu      sync.RWMutex
+	conn    *zk.Conn
+	events  <-chan zk.Event
+	servers []string
+	timeout time.Duration
+}
+
+// NewZK creates a new connection to the given ZooKeeper ensemble.
+func NewZK(servers []string, recvTimeout time.Duration) (*ZK, error) {
+	conn, events, err := zk.Connect(servers, recvTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &ZK{conn: conn, events: events, servers: servers, timeout: recvTimeout}, nil
+}
+
+// SessionEvents returns the stream of connection state changes for the
+// current session, including zk.StateExpired when the session is lost.
+func (z *ZK) SessionEvents() <-chan zk.Event {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.events
+}
+
+// Reconnect replaces the current connection with a fresh one to the
+// same ensemble. It is used to recover after a session expiration.
+func (z *ZK) Reconnect() error {
+	conn, events, err := zk.Connect(z.servers, z.timeout)
+	if err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	old := z.conn
+	z.conn, z.events = conn, events
+	z.mu.Unlock()
+
+	old.Close()
+	return nil
+}
+
+func (z *ZK) getConn() *zk.Conn {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.conn
+}
+
+// Close closes the underlying ZooKeeper connection.
+func (z *ZK) Close() {
+	z.getConn().Close()
+}
+
+// DeleteAll recursively removes a ZooKeeper node and all of its
+// children. It is a no-op if the node does not exist.
+func (z *ZK) DeleteAll(root string) error {
+	children, _, err := z.getConn().Children(root)
+	if err == zk.ErrNoNode {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if err := z.DeleteAll(root + "/" + child); err != nil {
+			return err
+		}
+	}
+
+	_, stat, err := z.getConn().Exists(root)
+	if err != nil {
+		return err
+	}
+	if stat == nil {
+		return nil
+	}
+	return z.getConn().Delete(root, stat.Version)
+}
+
+// mkdirAll creates a persistent ZooKeeper node and any missing parents.
+func (z *ZK) mkdirAll(path string) error {
+	if path == "" || path == "/" {
+		return nil
+	}
+	exists, _, err := z.getConn().Exists(path)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if idx := strings.LastIndex(path, "/"); idx > 0 {
+		if err := z.mkdirAll(path[:idx]); err != nil {
+			return err
+		}
+	}
+	_, err = z.getConn().Create(path, nil, 0, zk.WorldACL(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+	return nil
+}
+
+// RegisterGroup ensures the persistent nodes for a consumer group exist.
+func (z *ZK) RegisterGroup(group string) error {
+	return z.mkdirAll(fmt.Sprintf("/consumers/%s/ids", group))
+}
+
+// RegisterConsumer registers id as an ephemeral member of group,
+// subscribed to topics. It overwrites any previous registration for id.
+func (z *ZK) RegisterConsumer(group, id string, topics []string) error {
+	path := fmt.Sprintf("/consumers/%s/ids/%s", group, id)
+	data := []byte(strings.Join(topics, ","))
+
+	if err := z.mkdirAll(fmt.Sprintf("/consumers/%s/ids", group)); err != nil {
+		return err
+	}
+	if _, err := z.getConn().Create(path, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll)); err == zk.ErrNodeExists {
+		_, stat, err := z.getConn().Get(path)
+		if err != nil {
+			return err
+		}
+		_, err = z.getConn().Set(path, data, stat.Version)
+		return err
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Members returns the set of group members currently registered, along
+// with the topics each one subscribes to.
+func (z *ZK) Members(group string) (map[string][]string, error) {
+	members, _, err := z.MembersW(group)
+	return members, err
+}
+
+// MembersW behaves like Members, but also sets a ZooKeeper watch on the
+// group's ids node and returns a channel that fires exactly once, when
+// the member set next changes (a join or a leave). Callers should
+// re-invoke MembersW after the channel fires to keep watching.
+func (z *ZK) MembersW(group string) (map[string][]string, <-chan zk.Event, error) {
+	root := fmt.Sprintf("/consumers/%s/ids", group)
+	ids, _, events, err := z.getConn().ChildrenW(root)
+	if err == zk.ErrNoNode {
+		return map[string][]string{}, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(ids)
+
+	members := make(map[string][]string, len(ids))
+	for _, id := range ids {
+		data, _, err := z.getConn().Get(root + "/" + id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) == 0 {
+			members[id] = nil
+			continue
+		}
+		members[id] = strings.Split(string(data), ",")
+	}
+	return members, events, nil
+}
+
+// Claim registers id as the owner of partition of topic within group,
+// replacing any prior claim.
+func (z *ZK) Claim(group, topic string, partition int32, id string) error {
+	path := fmt.Sprintf("/consumers/%s/owners/%s/%d", group, topic, partition)
+	if err := z.mkdirAll(fmt.Sprintf("/consumers/%s/owners/%s", group, topic)); err != nil {
+		return err
+	}
+	z.getConn().Delete(path, -1)
+	_, err := z.getConn().Create(path, []byte(id), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+// Unclaim removes this member's claim on partition of topic within
+// group, if any. It is a no-op if the partition is not currently
+// claimed.
+func (z *ZK) Unclaim(group, topic string, partition int32) error {
+	path := fmt.Sprintf("/consumers/%s/owners/%s/%d", group, topic, partition)
+	err := z.getConn().Delete(path, -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// CommitOffset persists offset as the last committed offset for
+// topic/partition within group, creating or overwriting the node as
+// needed.
+func (z *ZK) CommitOffset(group, topic string, partition int32, offset int64) error {
+	path := fmt.Sprintf("/consumers/%s/offsets/%s/%d", group, topic, partition)
+	data := []byte(strconv.FormatInt(offset, 10))
+
+	if err := z.mkdirAll(fmt.Sprintf("/consumers/%s/offsets/%s", group, topic)); err != nil {
+		return err
+	}
+
+	_, stat, err := z.getConn().Exists(path)
+	if err != nil {
+		return err
+	}
+	if stat == nil {
+		_, err = z.getConn().Create(path, data, 0, zk.WorldACL(zk.PermAll))
+		return err
+	}
+	_, err = z.getConn().Set(path, data, stat.Version)
+	return err
+}
+
+// Offset returns the last committed offset for topic/partition within
+// group, or 0 if nothing has been committed yet.
+func (z *ZK) Offset(group, topic string, partition int32) (int64, error) {
+	path := fmt.Sprintf("/consumers/%s/offsets/%s/%d", group, topic, partition)
+
+	data, _, err := z.getConn().Get(path)
+	if err == zk.ErrNoNode {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}